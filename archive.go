@@ -1,40 +1,88 @@
 package archive
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"os"
 	"path"
+	"regexp"
+	"sync"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/sync/errgroup"
 
 	"pault.ag/go/debian/control"
 	"pault.ag/go/debian/dependency"
-	"pault.ag/go/debian/transput"
+	"pault.ag/go/debian/hashio"
 )
 
 // Archive {{{
 
+// Archive is a handle on a repository root, reached through a Fetcher.
+// NewArchive reads one off local disk; NewRemoteArchive reaches one over
+// HTTP(S).
 type Archive struct {
-	root string
+	fetcher Fetcher
+	keyring openpgp.KeyRing
 }
 
-func NewArchive(root string) Archive {
-	return Archive{root: root}
+// ArchiveOption configures an Archive returned by NewArchive or
+// NewRemoteArchive.
+type ArchiveOption func(*Archive)
+
+// WithKeyring makes Suite verify the OpenPGP clearsign signature on
+// InRelease against keyring before parsing it. Without this option, Suite
+// parses InRelease's plaintext without checking its signature, which is
+// only safe against a Fetcher you already trust (e.g. a local mirror you
+// verified out of band).
+func WithKeyring(keyring openpgp.KeyRing) ArchiveOption {
+	return func(a *Archive) { a.keyring = keyring }
 }
 
-func (a Archive) Suite(name string) (*Suite, error) {
-	inRelease := path.Join(a.root, "dists", name, "InRelease")
-	suite := Suite{Binaries: map[string]Binaries{}}
+func NewArchive(root string, opts ...ArchiveOption) Archive {
+	a := Archive{fetcher: fsFetcher{root: root}}
+	for _, opt := range opts {
+		opt(&a)
+	}
+	return a
+}
 
-	/* Feature flags */
-	suite.features.Hashes = []string{"sha256", "sha512"}
+func (a Archive) Suite(name string) (*Suite, error) {
+	fd, err := a.fetcher.Open(path.Join("dists", name, "InRelease"))
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
 
-	fd, err := os.Open(inRelease)
+	raw, err := io.ReadAll(fd)
 	if err != nil {
 		return nil, err
 	}
 
-	defer fd.Close()
-	return &suite, control.Unmarshal(&suite, fd)
+	block, _ := clearsign.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("InRelease: not a clearsigned message")
+	}
+	body := block.Plaintext
+
+	if a.keyring != nil {
+		if _, err := openpgp.CheckDetachedSignature(a.keyring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body); err != nil {
+			return nil, fmt.Errorf("InRelease: signature verification failed: %w", err)
+		}
+	}
+
+	suite := NewSuite()
+	suite.fetcher = a.fetcher
+	suite.dists = name
+
+	if err := control.Unmarshal(&suite, bytes.NewReader(body)); err != nil {
+		return nil, err
+	}
+	return &suite, nil
 }
 
 // }}}
@@ -51,27 +99,84 @@ type Suite struct {
 	Suite       string
 	Codename    string
 
+	ReleaseComponents    []string          `control:"Components"`
+	ReleaseArchitectures []dependency.Arch `control:"Architectures"`
+
+	SHA256 []control.SHA256FileHash `control:"SHA256" delim:"\n" strip:" \t\n\r" multiline:"true"`
+	SHA512 []control.SHA512FileHash `control:"SHA512" delim:"\n" strip:" \t\n\r" multiline:"true"`
+
 	Binaries map[string]Binaries
+	Sources  map[string][]Source
+
+	fetcher Fetcher
+	dists   string
+	mu      sync.Mutex
 
 	features struct {
-		Hashes []string
-		/* Compressors ... */
+		Hashes      []string
+		Compressors []string
 	}
 }
 
-func NewHashers(suite Suite, target io.Writer) (io.Writer, []*transput.Hasher, error) {
-	return transput.NewHasherWriters(suite.features.Hashes, target)
+// NewSuite creates an empty Suite with the default feature flags (sha256 and
+// sha512 hashes, gzip and xz compressors, plus an uncompressed copy of every
+// index) used by Publisher. Suite values returned by Archive.Suite start from
+// these same defaults; the feature flags are not read back from InRelease.
+func NewSuite() Suite {
+	return Suite{
+		Binaries: map[string]Binaries{},
+		Sources:  map[string][]Source{},
+		features: struct {
+			Hashes      []string
+			Compressors []string
+		}{
+			Hashes:      []string{"sha256", "sha512"},
+			Compressors: []string{"", "gzip", "xz"},
+		},
+	}
 }
 
-func (s Suite) Components() []string {
+// NewHashers returns an io.Writer that feeds target plus one hashio.Hasher
+// per name in suite.features.Hashes, so that a single write both persists
+// the data and accumulates every digest Release needs to record for it.
+func NewHashers(suite *Suite, target io.Writer) (io.Writer, []*hashio.Hasher, error) {
+	writers := make([]io.Writer, 1, len(suite.features.Hashes)+1)
+	writers[0] = target
+
+	hashers := make([]*hashio.Hasher, 0, len(suite.features.Hashes))
+	for _, name := range suite.features.Hashes {
+		hasher, err := hashio.NewHasher(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		hashers = append(hashers, hasher)
+		writers = append(writers, hasher)
+	}
+	return io.MultiWriter(writers...), hashers, nil
+}
+
+// Components returns every component with at least a Binaries or a Sources
+// entry, so that a component populated via AddSourceTo alone (no binaries
+// built for it yet) still shows up in the Release this Suite publishes.
+func (s *Suite) Components() []string {
+	seen := map[string]bool{}
 	components := []string{}
-	for component, _ := range s.Binaries {
-		components = append(components, component)
+	for component := range s.Binaries {
+		if !seen[component] {
+			seen[component] = true
+			components = append(components, component)
+		}
+	}
+	for component := range s.Sources {
+		if !seen[component] {
+			seen[component] = true
+			components = append(components, component)
+		}
 	}
 	return components
 }
 
-func (s Suite) AddPackageTo(component string, pkg Package) {
+func (s *Suite) AddPackageTo(component string, pkg Package) {
 	if _, ok := s.Binaries[component]; !ok {
 		s.Binaries[component] = Binaries{
 			arches: map[string][]Package{},
@@ -80,6 +185,126 @@ func (s Suite) AddPackageTo(component string, pkg Package) {
 	s.Binaries[component].Add(pkg)
 }
 
+func (s *Suite) AddSourceTo(component string, src Source) {
+	s.Sources[component] = append(s.Sources[component], src)
+}
+
+var (
+	binariesPathRe = regexp.MustCompile(`^([^/]+)/binary-([^/]+)/Packages$`)
+	sourcesPathRe  = regexp.MustCompile(`^([^/]+)/source/Sources$`)
+)
+
+// Load fetches and hash-verifies every Packages and Sources file this
+// Suite's InRelease declared, up to 8 at a time, and populates Binaries and
+// Sources with the result, replacing whatever a previous Load call recorded
+// for that component/arch or component. Suite values returned by
+// Archive.Suite start out with both empty; call Load before ranging over
+// them. It is safe to call Load concurrently with itself, and safe to call
+// more than once (e.g. to refresh a Suite polled off a remote mirror)
+// without accumulating duplicate entries.
+func (s *Suite) Load(ctx context.Context) error {
+	group, _ := errgroup.WithContext(ctx)
+	group.SetLimit(8)
+
+	for _, fh := range s.SHA256 {
+		fh := fh
+		if m := binariesPathRe.FindStringSubmatch(fh.Filename); m != nil {
+			component, archName := m[1], m[2]
+			group.Go(func() error { return s.loadBinaries(component, archName, fh.Filename, fh.Hash) })
+			continue
+		}
+		if m := sourcesPathRe.FindStringSubmatch(fh.Filename); m != nil {
+			component := m[1]
+			group.Go(func() error { return s.loadSources(component, fh.Filename, fh.Hash) })
+		}
+	}
+
+	return group.Wait()
+}
+
+// fetchVerified fetches relpath relative to this Suite's dists/$SUITE
+// directory and returns its bytes, after checking that its SHA256 digest
+// matches wantSHA256.
+func (s *Suite) fetchVerified(relpath, wantSHA256 string) ([]byte, error) {
+	fd, err := s.fetcher.Open(path.Join("dists", s.dists, relpath))
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	raw, err := io.ReadAll(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(raw)
+	if got := hex.EncodeToString(sum[:]); got != wantSHA256 {
+		return nil, fmt.Errorf("%s: SHA256 mismatch: Release says %s, got %s", relpath, wantSHA256, got)
+	}
+	return raw, nil
+}
+
+func (s *Suite) loadBinaries(component, archName, relpath, wantSHA256 string) error {
+	raw, err := s.fetchVerified(relpath, wantSHA256)
+	if err != nil {
+		return err
+	}
+
+	packages, err := LoadPackages(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+
+	pkgs := []Package{}
+	for {
+		pkg, err := packages.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		pkgs = append(pkgs, *pkg)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Binaries[component]; !ok {
+		s.Binaries[component] = Binaries{arches: map[string][]Package{}}
+	}
+	s.Binaries[component].arches[archName] = pkgs
+	return nil
+}
+
+func (s *Suite) loadSources(component, relpath, wantSHA256 string) error {
+	raw, err := s.fetchVerified(relpath, wantSHA256)
+	if err != nil {
+		return err
+	}
+
+	sources, err := LoadSources(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+
+	srcs := []Source{}
+	for {
+		src, err := sources.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		srcs = append(srcs, *src)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Sources[component] = srcs
+	return nil
+}
+
 // }}}
 
 // Binaries {{{
@@ -0,0 +1,97 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"pault.ag/go/debian/control"
+)
+
+// writeIndexFixture control-encodes value to dir/relpath and returns a
+// SHA256FileHash describing it. Its Filename is relpath as given (relative
+// to dir), whereas a Suite's SHA256 field lists paths relative to
+// dists/$SUITE, so callers take only its Size and Hash from it.
+func writeIndexFixture(t *testing.T, dir, relpath string, value interface{}) control.SHA256FileHash {
+	t.Helper()
+
+	var buf bytes.Buffer
+	encoder, err := control.NewEncoder(&buf)
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+	if err := encoder.Encode(value); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	full := filepath.Join(dir, relpath)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(full, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile(%s): %v", relpath, err)
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return control.SHA256FileHash{
+		FileHash: control.FileHash{
+			Filename: relpath,
+			Size:     int64(buf.Len()),
+			Hash:     hex.EncodeToString(sum[:]),
+		},
+	}
+}
+
+func TestSuiteLoadTwiceDoesNotDuplicate(t *testing.T) {
+	root := t.TempDir()
+
+	packagesHash := writeIndexFixture(t, root, "dists/unstable/main/binary-amd64/Packages", testPackage(t, "testpkg", "1.0", "amd64", nil))
+	sourcesHash := writeIndexFixture(t, root, "dists/unstable/main/source/Sources", testSource(t, "testsrc", "1.0", ""))
+
+	suite := NewSuite()
+	suite.fetcher = fsFetcher{root: root}
+	suite.dists = "unstable"
+	suite.SHA256 = []control.SHA256FileHash{
+		{FileHash: control.FileHash{Filename: "main/binary-amd64/Packages", Size: packagesHash.Size, Hash: packagesHash.Hash}},
+		{FileHash: control.FileHash{Filename: "main/source/Sources", Size: sourcesHash.Size, Hash: sourcesHash.Hash}},
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := suite.Load(context.Background()); err != nil {
+			t.Fatalf("Load #%d: %v", i+1, err)
+		}
+	}
+
+	arch := mustArch(t, "amd64")
+	if got := suite.Binaries["main"].Get(arch); len(got) != 1 {
+		t.Errorf("Binaries[main].Get(amd64) after two Load calls = %+v, want one entry", got)
+	}
+	if got := suite.Sources["main"]; len(got) != 1 {
+		t.Errorf("Sources[main] after two Load calls = %+v, want one entry", got)
+	}
+}
+
+func TestSuiteComponentsIncludesSourceOnly(t *testing.T) {
+	suite := NewSuite()
+	suite.AddPackageTo("main", testPackage(t, "testpkg", "1.0", "amd64", nil))
+	suite.AddSourceTo("extra", testSource(t, "testsrc", "1.0", ""))
+
+	components := suite.Components()
+	sort.Strings(components)
+
+	want := []string{"extra", "main"}
+	if len(components) != len(want) {
+		t.Fatalf("Components() = %v, want %v", components, want)
+	}
+	for i, c := range want {
+		if components[i] != c {
+			t.Errorf("Components() = %v, want %v", components, want)
+			break
+		}
+	}
+}
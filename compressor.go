@@ -0,0 +1,122 @@
+package archive
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Compressor {{{
+
+// Compressor produces one compressed variant of an index file. Name is the
+// value used in suite.features.Compressors; Extension is the suffix the
+// compressed file gets (e.g. "gzip" writes ".gz"). The identity
+// Compressor's Name and Extension are both the empty string.
+type Compressor interface {
+	Name() string
+	Extension() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+var compressors = map[string]Compressor{}
+
+// RegisterCompressor makes a Compressor available under its Name() to
+// Publisher, so that callers can list it in
+// suite.features.Compressors. Registering a Compressor under a Name that is
+// already taken replaces the previous one.
+func RegisterCompressor(c Compressor) {
+	compressors[c.Name()] = c
+}
+
+// GetCompressor looks up a Compressor previously passed to
+// RegisterCompressor by name.
+func GetCompressor(name string) (Compressor, error) {
+	c, ok := compressors[name]
+	if !ok {
+		return nil, fmt.Errorf("No such compressor: '%s'", name)
+	}
+	return c, nil
+}
+
+func init() {
+	RegisterCompressor(identityCompressor{})
+	RegisterCompressor(gzipCompressor{})
+	RegisterCompressor(xzCompressor{})
+	RegisterCompressor(bzip2Compressor{})
+	RegisterCompressor(zstdCompressor{})
+}
+
+// }}}
+
+// identityCompressor {{{
+
+type identityCompressor struct{}
+
+func (identityCompressor) Name() string      { return "" }
+func (identityCompressor) Extension() string { return "" }
+
+func (identityCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// }}}
+
+// gzipCompressor {{{
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string      { return "gzip" }
+func (gzipCompressor) Extension() string { return "gz" }
+
+func (gzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+// }}}
+
+// xzCompressor {{{
+
+type xzCompressor struct{}
+
+func (xzCompressor) Name() string      { return "xz" }
+func (xzCompressor) Extension() string { return "xz" }
+
+func (xzCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return xz.NewWriter(w)
+}
+
+// }}}
+
+// bzip2Compressor {{{
+
+type bzip2Compressor struct{}
+
+func (bzip2Compressor) Name() string      { return "bzip2" }
+func (bzip2Compressor) Extension() string { return "bz2" }
+
+func (bzip2Compressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return bzip2.NewWriter(w, nil)
+}
+
+// }}}
+
+// zstdCompressor {{{
+
+type zstdCompressor struct{}
+
+func (zstdCompressor) Name() string      { return "zstd" }
+func (zstdCompressor) Extension() string { return "zst" }
+
+func (zstdCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
+
+// }}}
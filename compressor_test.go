@@ -0,0 +1,39 @@
+package archive
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressorRoundTrip(t *testing.T) {
+	for _, name := range []string{"", "gzip", "xz", "bzip2", "zstd"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			compressor, err := GetCompressor(name)
+			if err != nil {
+				t.Fatalf("GetCompressor(%q): %v", name, err)
+			}
+
+			var buf bytes.Buffer
+			w, err := compressor.NewWriter(&buf)
+			if err != nil {
+				t.Fatalf("NewWriter: %v", err)
+			}
+			if _, err := w.Write([]byte("Package: foo\n")); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if buf.Len() == 0 {
+				t.Fatal("NewWriter produced no output")
+			}
+		})
+	}
+}
+
+func TestGetCompressorUnknown(t *testing.T) {
+	if _, err := GetCompressor("lz4"); err == nil {
+		t.Fatal("GetCompressor(\"lz4\") succeeded, want error")
+	}
+}
@@ -0,0 +1,146 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/deb"
+	"pault.ag/go/debian/dependency"
+)
+
+// ContentEntry {{{
+
+// ContentEntry is one line of a Contents-$ARCH index: the path of a file
+// inside some .deb, and the section/package that ships it.
+type ContentEntry struct {
+	Path    string
+	Section string
+}
+
+// }}}
+
+// WriteContentsTo {{{
+
+// WriteContentsTo writes a Contents-$ARCH index for arch to out: one
+// sorted "path\tsection/package" line per regular file found in every
+// package's data.tar, across all packages this Binaries holds for arch; a
+// package with no Section field is written as plain "package".
+// debOpener is responsible for handing back the .deb backing a Package,
+// e.g. by opening it from the pool/ directory Archive.Include fills. It returns
+// the opened file alongside the path deb.Load should report it as and an
+// io.Closer for that file; WriteContentsTo closes it (and the deb.Deb's own
+// decompressor) once it is done with each package, so a real archive with
+// thousands of packages per arch doesn't leak a goroutine/fd per package.
+func (b Binaries) WriteContentsTo(arch dependency.Arch, debOpener func(Package) (io.ReaderAt, string, io.Closer, error), out io.Writer) error {
+	packages, ok := b.arches[arch.String()]
+	if !ok {
+		return fmt.Errorf("No such arch: '%s'", arch)
+	}
+
+	entries := []ContentEntry{}
+	for _, pkg := range packages {
+		if err := func() error {
+			reader, pathname, closer, err := debOpener(pkg)
+			if err != nil {
+				return err
+			}
+			if closer != nil {
+				defer closer.Close()
+			}
+
+			d, err := deb.Load(reader, pathname)
+			if err != nil {
+				return err
+			}
+			defer d.Close()
+
+			owner := pkg.Package
+			if section := strings.TrimSpace(pkg.Paragraph.Values["Section"]); section != "" {
+				owner = section + "/" + pkg.Package
+			}
+
+			for {
+				hdr, err := d.Data.Next()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if hdr.Typeflag != tar.TypeReg {
+					continue
+				}
+				entries = append(entries, ContentEntry{
+					Path:    path.Clean("/" + strings.TrimPrefix(hdr.Name, "./")),
+					Section: owner,
+				})
+			}
+		}(); err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	w := bufio.NewWriter(out)
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", entry.Path, entry.Section); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// }}}
+
+// Contents {{{
+
+// Contents is a parsed Contents-$ARCH index, ready for reverse file
+// lookups via Lookup.
+type Contents struct {
+	entries []ContentEntry
+}
+
+// LoadContents parses a Contents-$ARCH index as written by
+// WriteContentsTo (or by dak/reprepro, which use the same format).
+func LoadContents(in io.Reader) (*Contents, error) {
+	scanner := bufio.NewScanner(in)
+	entries := []ContentEntry{}
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		entries = append(entries, ContentEntry{
+			Path:    strings.Join(fields[:len(fields)-1], " "),
+			Section: fields[len(fields)-1],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &Contents{entries: entries}, nil
+}
+
+// Lookup returns every ContentEntry whose Path matches pathGlob (as
+// interpreted by path.Match), answering "which package ships
+// /usr/bin/foo?" the way apt-file does.
+func (c *Contents) Lookup(pathGlob string) []ContentEntry {
+	matches := []ContentEntry{}
+	for _, entry := range c.entries {
+		if ok, _ := path.Match(pathGlob, entry.Path); ok {
+			matches = append(matches, entry)
+		}
+	}
+	return matches
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,104 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// buildTestDeb assembles a minimal, valid .deb (ar archive with
+// debian-binary, control.tar and data.tar members, all left uncompressed
+// since deb.Tarfile passes unrecognized extensions through verbatim) around
+// a control paragraph and a single data file.
+func buildTestDeb(t *testing.T, control string, dataPath string, dataContent []byte) []byte {
+	t.Helper()
+
+	controlTar := &bytes.Buffer{}
+	tw := tar.NewWriter(controlTar)
+	writeTarFile(t, tw, "control", []byte(control))
+	if err := tw.Close(); err != nil {
+		t.Fatalf("control tar.Close: %v", err)
+	}
+
+	dataTar := &bytes.Buffer{}
+	tw = tar.NewWriter(dataTar)
+	writeTarFile(t, tw, dataPath, dataContent)
+	if err := tw.Close(); err != nil {
+		t.Fatalf("data tar.Close: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("!<arch>\n")
+	writeArMember(buf, "debian-binary", []byte("2.0\n"))
+	writeArMember(buf, "control.tar", controlTar.Bytes())
+	writeArMember(buf, "data.tar", dataTar.Bytes())
+	return buf.Bytes()
+}
+
+func writeTarFile(t *testing.T, tw *tar.Writer, name string, content []byte) {
+	t.Helper()
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatalf("tar.WriteHeader(%s): %v", name, err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatalf("tar.Write(%s): %v", name, err)
+	}
+}
+
+func writeArMember(buf *bytes.Buffer, name string, data []byte) {
+	fmt.Fprintf(buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", name, 0, 0, 0, "100644", len(data))
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte('\n')
+	}
+}
+
+func TestWriteContentsTo(t *testing.T) {
+	arch := mustArch(t, "amd64")
+	pkg := testPackage(t, "testpkg", "1.0", "amd64", nil)
+
+	deb := buildTestDeb(t,
+		"Package: testpkg\nVersion: 1.0\nArchitecture: amd64\nMaintainer: Test <test@example.com>\nDescription: test\n",
+		"./usr/bin/testpkg", []byte("#!/bin/sh\n"))
+
+	suite := NewSuite()
+	suite.AddPackageTo("main", pkg)
+
+	var out bytes.Buffer
+	err := suite.Binaries["main"].WriteContentsTo(arch, func(p Package) (io.ReaderAt, string, io.Closer, error) {
+		return bytes.NewReader(deb), "testpkg_1.0_amd64.deb", nil, nil
+	}, &out)
+	if err != nil {
+		t.Fatalf("WriteContentsTo: %v", err)
+	}
+
+	if !strings.Contains(out.String(), "/usr/bin/testpkg\ttestpkg\n") {
+		t.Fatalf("Contents output = %q, want a line for /usr/bin/testpkg", out.String())
+	}
+
+	contents, err := LoadContents(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatalf("LoadContents: %v", err)
+	}
+	matches := contents.Lookup("/usr/bin/*")
+	if len(matches) != 1 || matches[0].Path != "/usr/bin/testpkg" {
+		t.Fatalf("Lookup(/usr/bin/*) = %+v, want one match for /usr/bin/testpkg", matches)
+	}
+}
+
+func TestWriteContentsToUnknownArch(t *testing.T) {
+	suite := NewSuite()
+	suite.AddPackageTo("main", testPackage(t, "testpkg", "1.0", "amd64", nil))
+
+	err := suite.Binaries["main"].WriteContentsTo(mustArch(t, "arm64"), func(p Package) (io.ReaderAt, string, io.Closer, error) {
+		t.Fatal("debOpener should not be called for an arch with no packages")
+		return nil, "", nil, nil
+	}, io.Discard)
+	if err == nil {
+		t.Fatal("WriteContentsTo succeeded for an arch with no packages, want error")
+	}
+}
@@ -0,0 +1,34 @@
+package archive
+
+import (
+	"io"
+	"os"
+	"path"
+)
+
+// Fetcher {{{
+
+// Fetcher abstracts how Archive reads the files that make up a repository,
+// so that Archive itself doesn't need to know whether they live on local
+// disk or behind an HTTP(S) mirror. relpath is always relative to the
+// archive root, e.g. "dists/stable/InRelease" or
+// "dists/stable/main/binary-amd64/Packages".
+type Fetcher interface {
+	Open(relpath string) (io.ReadCloser, error)
+}
+
+// }}}
+
+// fsFetcher {{{
+
+// fsFetcher is the Fetcher used by NewArchive: it reads relpath straight
+// off local disk, rooted at root.
+type fsFetcher struct {
+	root string
+}
+
+func (f fsFetcher) Open(relpath string) (io.ReadCloser, error) {
+	return os.Open(path.Join(f.root, relpath))
+}
+
+// }}}
@@ -0,0 +1,41 @@
+package archive
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFsFetcherOpen(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "dists", "stable"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("InRelease contents")
+	if err := os.WriteFile(filepath.Join(dir, "dists", "stable", "InRelease"), want, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := fsFetcher{root: dir}
+	fd, err := fetcher.Open("dists/stable/InRelease")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer fd.Close()
+
+	got, err := io.ReadAll(fd)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("Open returned %q, want %q", got, want)
+	}
+}
+
+func TestFsFetcherOpenMissing(t *testing.T) {
+	fetcher := fsFetcher{root: t.TempDir()}
+	if _, err := fetcher.Open("dists/stable/InRelease"); err == nil {
+		t.Fatal("Open of a missing file succeeded, want error")
+	}
+}
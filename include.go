@@ -0,0 +1,329 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/deb"
+)
+
+// Policy {{{
+
+// Policy is consulted by Archive.Include once a .changes file's signature
+// and the hashes of every file it references have already been verified,
+// but before anything is moved into the pool or added to suite. Returning
+// an error rejects the upload; Allow is free to inspect changes for the
+// uploader's key, the target Distribution, or anything else a site needs
+// to enforce (per-uploader ACLs, distribution overrides, ...).
+type Policy interface {
+	Allow(changes *control.Changes, suite *Suite) error
+}
+
+// }}}
+
+// IncludeOptions {{{
+
+// IncludeOptions configures a single call to Archive.Include.
+type IncludeOptions struct {
+	// Component is the archive component (e.g. "main") new Source and
+	// Package entries are filed under.
+	Component string
+
+	// Policy, if set, is given a chance to reject the upload after its
+	// signature and file hashes check out. See the Policy docs.
+	Policy Policy
+
+	// Keyring verifies the .changes file's OpenPGP signature. A nil
+	// Keyring skips verification, which is only safe for uploads that
+	// were already vetted out of band.
+	Keyring openpgp.KeyRing
+}
+
+// }}}
+
+// IncludeResult {{{
+
+// IncludeResult reports what Archive.Include added to the target Suite.
+type IncludeResult struct {
+	Source   *Source
+	Packages []Package
+}
+
+// }}}
+
+// poolLetter {{{
+
+// poolLetter returns the directory a source package's pool files are
+// grouped under: the first four characters for "lib*" sources (matching
+// dak/dput, since there would otherwise be one directory per libfoo*
+// source), the first character for everything else.
+func poolLetter(source string) string {
+	if strings.HasPrefix(source, "lib") && len(source) > 3 {
+		return source[:4]
+	}
+	return source[:1]
+}
+
+// }}}
+
+// Include {{{
+
+// Include parses the .changes file at changesPath, verifies its OpenPGP
+// signature against opts.Keyring, checks every file it references against
+// its declared size and SHA256, moves those files into
+// pool/$component/$sourceletter/$source/, and adds the Source and Package
+// entries they describe to suite. opts.Policy, if set, gets a final say
+// before anything is written.
+func (a Archive) Include(changesPath string, suite *Suite, opts IncludeOptions) (*IncludeResult, error) {
+	raw, err := os.ReadFile(changesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := clearsign.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("%s: not a clearsigned message", changesPath)
+	}
+	if opts.Keyring != nil {
+		if _, err := openpgp.CheckDetachedSignature(opts.Keyring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body); err != nil {
+			return nil, fmt.Errorf("%s: signature verification failed: %w", changesPath, err)
+		}
+	}
+
+	changes := control.Changes{}
+	if err := control.Unmarshal(&changes, bytes.NewReader(block.Plaintext)); err != nil {
+		return nil, err
+	}
+
+	if suite.Suite != "" && changes.Distribution != suite.Suite {
+		return nil, fmt.Errorf("%s: Distribution %q does not match suite %q", changesPath, changes.Distribution, suite.Suite)
+	}
+
+	dir := path.Dir(changesPath)
+	for _, fh := range changes.Files {
+		if err := verifyArtifact(path.Join(dir, fh.Filename), fh.Size, fh.Hash); err != nil {
+			return nil, err
+		}
+	}
+	for _, fh := range changes.ChecksumsSha256 {
+		if err := verifySHA256(path.Join(dir, fh.Filename), fh.Hash); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Policy != nil {
+		if err := opts.Policy.Allow(&changes, suite); err != nil {
+			return nil, fmt.Errorf("%s: rejected: %w", changesPath, err)
+		}
+	}
+
+	sha256ByFile := make(map[string]string, len(changes.ChecksumsSha256))
+	for _, fh := range changes.ChecksumsSha256 {
+		sha256ByFile[fh.Filename] = fh.Hash
+	}
+
+	result := &IncludeResult{}
+
+	for _, fh := range changes.Files {
+		switch {
+		case strings.HasSuffix(fh.Filename, ".dsc"):
+			src, err := a.includeDsc(dir, fh.Filename, opts.Component)
+			if err != nil {
+				return nil, err
+			}
+			suite.AddSourceTo(opts.Component, *src)
+			result.Source = src
+
+		case strings.HasSuffix(fh.Filename, ".deb") || strings.HasSuffix(fh.Filename, ".udeb"):
+			pkg, err := a.includeDeb(dir, fh.Filename, opts.Component, fh.Size, fh.Hash, sha256ByFile[fh.Filename])
+			if err != nil {
+				return nil, err
+			}
+			suite.AddPackageTo(opts.Component, *pkg)
+			result.Packages = append(result.Packages, *pkg)
+		}
+	}
+
+	for _, fh := range changes.Files {
+		if err := os.Remove(path.Join(dir, fh.Filename)); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (a Archive) includeDsc(dir, filename, component string) (*Source, error) {
+	root, err := a.rootDir()
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := os.Open(path.Join(dir, filename))
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	dsc := control.DSC{}
+	if err := control.Unmarshal(&dsc, fd); err != nil {
+		return nil, err
+	}
+
+	poolDir := path.Join("pool", component, poolLetter(dsc.Source), dsc.Source)
+	src, err := SourceFromDsc(&dsc, poolDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := copyIntoPool(root, poolDir, path.Join(dir, filename)); err != nil {
+		return nil, err
+	}
+	for _, fh := range src.Files {
+		if err := copyIntoPool(root, poolDir, path.Join(dir, fh.Filename)); err != nil {
+			return nil, err
+		}
+	}
+	return src, nil
+}
+
+func (a Archive) includeDeb(dir, filename, component string, size int64, md5sum, sha256 string) (*Package, error) {
+	root, err := a.rootDir()
+	if err != nil {
+		return nil, err
+	}
+
+	fullpath := path.Join(dir, filename)
+	fd, err := os.Open(fullpath)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	d, err := deb.Load(fd, fullpath)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	source := d.Control.Values["Source"]
+	if source == "" {
+		source = d.Control.Values["Package"]
+	}
+	poolDir := path.Join("pool", component, poolLetter(source), source)
+
+	pkg, err := PackageFromDeb(d, path.Join(poolDir, path.Base(filename)), size, md5sum, sha256)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := copyIntoPool(root, poolDir, fullpath); err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+// rootDir returns the filesystem root backing a, so that Include can move
+// files into its pool/. Include is only supported against a local Archive
+// (one created by NewArchive) for this reason.
+func (a Archive) rootDir() (string, error) {
+	fs, ok := a.fetcher.(fsFetcher)
+	if !ok {
+		return "", fmt.Errorf("Include: not a local Archive (created by NewArchive)")
+	}
+	return fs.root, nil
+}
+
+// copyIntoPool copies the file at srcPath into root/poolDir, creating
+// poolDir if necessary. The copy goes through a temporary file in the same
+// directory so that a reader racing the write never sees a partial file.
+func copyIntoPool(root, poolDir, srcPath string) error {
+	destDir := path.Join(root, poolDir)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(destDir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path.Join(destDir, path.Base(srcPath)))
+}
+
+// }}}
+
+// verifyArtifact {{{
+
+// verifyArtifact checks that the file at fullpath has the declared size
+// and MD5 hash, the same checks dput/dak run on every file a .changes
+// references before trusting it.
+func verifyArtifact(fullpath string, wantSize int64, wantMD5 string) error {
+	info, err := os.Stat(fullpath)
+	if err != nil {
+		return err
+	}
+	if info.Size() != wantSize {
+		return fmt.Errorf("%s: size mismatch: .changes says %d, got %d", fullpath, wantSize, info.Size())
+	}
+
+	fd, err := os.Open(fullpath)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	hasher := md5.New()
+	if _, err := io.Copy(hasher, fd); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hasher.Sum(nil)); got != wantMD5 {
+		return fmt.Errorf("%s: MD5 mismatch: .changes says %s, got %s", fullpath, wantMD5, got)
+	}
+	return nil
+}
+
+func verifySHA256(fullpath, wantSHA256 string) error {
+	fd, err := os.Open(fullpath)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, fd); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hasher.Sum(nil)); got != wantSHA256 {
+		return fmt.Errorf("%s: SHA256 mismatch: .changes says %s, got %s", fullpath, wantSHA256, got)
+	}
+	return nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,186 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+
+	"pault.ag/go/debian/control"
+)
+
+// writeIncludeFixture writes content to dir/name and returns a
+// FileListChangesFileHash and a SHA256FileHash describing it, ready to
+// append to a Changes' Files and ChecksumsSha256 fields respectively.
+func writeIncludeFixture(t *testing.T, dir, name string, content []byte) (control.FileListChangesFileHash, control.SHA256FileHash) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+		t.Fatalf("WriteFile(%s): %v", name, err)
+	}
+
+	md5sum := md5.Sum(content)
+	sha256sum := sha256.Sum256(content)
+
+	return control.FileListChangesFileHash{
+			FileHash: control.FileHash{
+				Filename: name,
+				Size:     int64(len(content)),
+				Hash:     hex.EncodeToString(md5sum[:]),
+			},
+			Component: "main",
+			Priority:  "optional",
+		}, control.SHA256FileHash{
+			FileHash: control.FileHash{
+				Filename: name,
+				Size:     int64(len(content)),
+				Hash:     hex.EncodeToString(sha256sum[:]),
+			},
+		}
+}
+
+// buildIncludeChangesFixture assembles a minimal upload (a .dsc, its
+// referenced orig tarball, and a .deb) under dir and returns a clearsigned
+// .changes file referencing all three, signed by a freshly generated key.
+func buildIncludeChangesFixture(t *testing.T, dir string) string {
+	t.Helper()
+
+	origFH, origSHA256 := writeIncludeFixture(t, dir, "testsrc_1.0.orig.tar.gz", []byte("orig tarball contents"))
+
+	dsc := control.DSC{
+		Format:           "3.0 (quilt)",
+		Source:           "testsrc",
+		Version:          mustVersion(t, "1.0-1"),
+		Maintainer:       "Test <test@example.com>",
+		StandardsVersion: "4.6.0",
+		Files: []control.MD5FileHash{{
+			FileHash: control.FileHash{
+				Filename: origFH.Filename,
+				Size:     origFH.Size,
+				Hash:     origFH.Hash,
+			},
+		}},
+	}
+	var dscBuf bytes.Buffer
+	dscEncoder, err := control.NewEncoder(&dscBuf)
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+	if err := dscEncoder.Encode(&dsc); err != nil {
+		t.Fatalf("Encode(dsc): %v", err)
+	}
+
+	dscFH, dscSHA256 := writeIncludeFixture(t, dir, "testsrc_1.0-1.dsc", dscBuf.Bytes())
+
+	deb := buildTestDeb(t,
+		"Package: testpkg\nVersion: 1.0-1\nArchitecture: amd64\nMaintainer: Test <test@example.com>\nDescription: test\n",
+		"./usr/bin/testpkg", []byte("#!/bin/sh\n"))
+	debFH, debSHA256 := writeIncludeFixture(t, dir, "testpkg_1.0-1_amd64.deb", deb)
+
+	// control.Changes has no MarshalControl support for its Files field
+	// (only UnmarshalControl, since real uploads are only ever decoded,
+	// never encoded by this library), so the fixture is assembled as raw
+	// control-file text instead of going through control.Encoder.
+	var changesBuf bytes.Buffer
+	fmt.Fprintf(&changesBuf, "Format: 1.8\n")
+	fmt.Fprintf(&changesBuf, "Source: testsrc\n")
+	fmt.Fprintf(&changesBuf, "Version: 1.0-1\n")
+	fmt.Fprintf(&changesBuf, "Distribution: unstable\n")
+	fmt.Fprintf(&changesBuf, "Maintainer: Test <test@example.com>\n")
+	fmt.Fprintf(&changesBuf, "Changed-By: Test <test@example.com>\n")
+	fmt.Fprintf(&changesBuf, "Checksums-Sha256:\n")
+	for _, fh := range []control.SHA256FileHash{dscSHA256, origSHA256, debSHA256} {
+		fmt.Fprintf(&changesBuf, " %s %d %s\n", fh.Hash, fh.Size, fh.Filename)
+	}
+	fmt.Fprintf(&changesBuf, "Files:\n")
+	for _, fh := range []control.FileListChangesFileHash{dscFH, origFH, debFH} {
+		fmt.Fprintf(&changesBuf, " %s %d %s %s %s\n", fh.Hash, fh.Size, fh.Component, fh.Priority, fh.Filename)
+	}
+
+	entity, err := openpgp.NewEntity("Test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("NewEntity: %v", err)
+	}
+
+	changesPath := filepath.Join(dir, "testsrc_1.0-1_amd64.changes")
+	fd, err := os.Create(changesPath)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer fd.Close()
+
+	w, err := clearsign.Encode(fd, entity.PrivateKey, nil)
+	if err != nil {
+		t.Fatalf("clearsign.Encode: %v", err)
+	}
+	if _, err := w.Write(changesBuf.Bytes()); err != nil {
+		t.Fatalf("clearsign write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("clearsign Close: %v", err)
+	}
+
+	return changesPath
+}
+
+func TestArchiveInclude(t *testing.T) {
+	incoming := t.TempDir()
+	changesPath := buildIncludeChangesFixture(t, incoming)
+
+	root := t.TempDir()
+	a := NewArchive(root)
+	suite := NewSuite()
+
+	result, err := a.Include(changesPath, &suite, IncludeOptions{Component: "main"})
+	if err != nil {
+		t.Fatalf("Include: %v", err)
+	}
+
+	if result.Source == nil || result.Source.Package != "testsrc" {
+		t.Fatalf("Include result.Source = %+v, want Package testsrc", result.Source)
+	}
+	if len(result.Packages) != 1 || result.Packages[0].Package != "testpkg" {
+		t.Fatalf("Include result.Packages = %+v, want one testpkg entry", result.Packages)
+	}
+	if pkg := result.Packages[0]; pkg.Size == 0 || pkg.MD5sum == "" || pkg.SHA256 == "" {
+		t.Errorf("Include result.Packages[0] = %+v, want non-zero Size/MD5sum/SHA256", pkg)
+	}
+
+	for _, want := range []string{
+		filepath.Join(root, "pool", "main", "t", "testsrc", "testsrc_1.0-1.dsc"),
+		filepath.Join(root, "pool", "main", "t", "testsrc", "testsrc_1.0.orig.tar.gz"),
+		filepath.Join(root, "pool", "main", "t", "testpkg", "testpkg_1.0-1_amd64.deb"),
+	} {
+		if _, err := os.Stat(want); err != nil {
+			t.Errorf("Stat(%s): %v", want, err)
+		}
+	}
+
+	if len(suite.Sources["main"]) != 1 {
+		t.Errorf("suite.Sources[main] = %+v, want one entry", suite.Sources["main"])
+	}
+	if len(suite.Binaries["main"].Get(mustArch(t, "amd64"))) != 1 {
+		t.Errorf("suite.Binaries[main] amd64 packages = %+v, want one entry", suite.Binaries["main"].Get(mustArch(t, "amd64")))
+	}
+}
+
+func TestArchiveIncludeBadHash(t *testing.T) {
+	incoming := t.TempDir()
+	changesPath := buildIncludeChangesFixture(t, incoming)
+
+	if err := os.WriteFile(filepath.Join(incoming, "testsrc_1.0.orig.tar.gz"), []byte("tampered"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	a := NewArchive(t.TempDir())
+	suite := NewSuite()
+	if _, err := a.Include(changesPath, &suite, IncludeOptions{Component: "main"}); err == nil {
+		t.Fatal("Include succeeded over a tampered file, want error")
+	}
+}
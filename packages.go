@@ -0,0 +1,117 @@
+package archive
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/deb"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Package {{{
+
+// The files dists/$DIST/$COMP/binary-$ARCH/Packages are called Packages
+// indices. Each paragraph describes one binary package built from a
+// Source, the same way a Source paragraph describes one upload.
+type Package struct {
+	control.Paragraph
+
+	Package      string
+	Source       string
+	Version      version.Version
+	Architecture dependency.Arch
+
+	Priority   string
+	Section    string
+	Maintainer string
+
+	// InstalledSize and Size are declared as int, not int64: the control
+	// package's struct (un)marshaling only special-cases reflect.Int, and
+	// errors out on any other integer kind.
+	InstalledSize int `control:"Installed-Size"`
+
+	Filename string
+	Size     int
+	MD5sum   string `control:"MD5sum"`
+	SHA256   string `control:"SHA256"`
+
+	Description string
+}
+
+// }}}
+
+// PackageFromDeb {{{
+
+// PackageFromDeb synthesizes a Package control Paragraph from an opened
+// .deb's control member, the same way SourceFromDsc does for a .dsc. The
+// .deb's own control member never declares Filename, Size or the pool
+// hashes (those are archive-management metadata, not package metadata), so
+// the caller passes in the file's final pool path, size and hashes once
+// the .deb has found its home in the pool.
+func PackageFromDeb(d *deb.Deb, filename string, size int64, md5sum, sha256 string) (*Package, error) {
+	pkg := Package{}
+
+	paragraph := d.Control.Paragraph
+	paragraph.Set("Filename", filename)
+	paragraph.Set("Size", strconv.FormatInt(size, 10))
+	paragraph.Set("MD5sum", md5sum)
+	paragraph.Set("SHA256", sha256)
+
+	return &pkg, control.UnpackFromParagraph(paragraph, &pkg)
+}
+
+// }}}
+
+// Packages {{{
+
+type Packages struct {
+	decoder *control.Decoder
+}
+
+// Next {{{
+
+// Get the next Package entry in the Packages list. This will return an
+// io.EOF at the last entry.
+func (p *Packages) Next() (*Package, error) {
+	next := Package{}
+	return &next, p.decoder.Decode(&next)
+}
+
+// }}}
+
+// LoadPackagesFile {{{
+
+// Given a path, create a Packages iterator. Note that the Packages file is
+// not OpenPGP signed, so one will need to verify the integrety of this file
+// from the InRelease file before trusting any output.
+func LoadPackagesFile(path string) (*Packages, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadPackages(fd)
+}
+
+// }}}
+
+// LoadPackages {{{
+
+// Given an io.Reader, create a Packages iterator. Note that the Packages
+// file is not OpenPGP signed, so one will need to verify the integrety of
+// this file from the InRelease file before trusting any output.
+func LoadPackages(in io.Reader) (*Packages, error) {
+	decoder, err := control.NewDecoder(in, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Packages{decoder: decoder}, nil
+}
+
+// }}}
+
+// }}}
+
+// vim: foldmethod=marker
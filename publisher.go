@@ -0,0 +1,296 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/hashio"
+)
+
+// Publisher {{{
+
+// Publisher takes a Suite that has been populated via AddPackageTo and
+// AddSourceTo and writes it out to disk as a complete, apt-consumable
+// archive: one Packages/Sources index per component per Compressor named in
+// suite.features.Compressors, and a Release file covering every generated
+// index. If Signer is set, the Release is also detached-signed to
+// Release.gpg and clearsigned to InRelease.
+type Publisher struct {
+	Suite  *Suite
+	Signer *openpgp.Entity
+
+	// Date stamps the Release file's Date field. NewPublisher sets it to
+	// the time of construction; callers wanting a reproducible Release
+	// (e.g. tests) can overwrite it before calling WriteTo.
+	Date time.Time
+}
+
+// NewPublisher creates a Publisher for suite. signer may be nil, in which
+// case WriteTo writes an unsigned Release only.
+func NewPublisher(suite *Suite, signer *openpgp.Entity) Publisher {
+	return Publisher{Suite: suite, Signer: signer, Date: time.Now()}
+}
+
+// fileEntry records the size and hashes of a single file written under
+// dists/$SUITE, relative to that directory, for inclusion in the Release.
+type fileEntry struct {
+	relpath string
+	size    int64
+	sha256  string
+	sha512  string
+}
+
+// countingWriter counts the number of bytes written through it.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// writeIndex writes one copy of the control output produced by encode per
+// Compressor named in suite.features.Compressors (e.g. Packages,
+// Packages.gz, Packages.xz) to dir, hashing every variant as it is written,
+// and returns a fileEntry for each.
+func (p Publisher) writeIndex(dir, relBase, name string, encode func(io.Writer) error) ([]fileEntry, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	writers := make([]io.Writer, 0, len(p.Suite.features.Compressors))
+	closers := []io.Closer{}
+	counters := make([]*countingWriter, 0, len(p.Suite.features.Compressors))
+	hasherLists := make([][]*hashio.Hasher, 0, len(p.Suite.features.Compressors))
+	relpaths := make([]string, 0, len(p.Suite.features.Compressors))
+
+	for _, compressorName := range p.Suite.features.Compressors {
+		compressor, err := GetCompressor(compressorName)
+		if err != nil {
+			return nil, err
+		}
+
+		filename := name
+		if ext := compressor.Extension(); ext != "" {
+			filename = name + "." + ext
+		}
+
+		fd, err := os.Create(path.Join(dir, filename))
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, fd)
+
+		counter := &countingWriter{}
+		hashOut, hashers, err := NewHashers(p.Suite, io.MultiWriter(fd, counter))
+		if err != nil {
+			return nil, err
+		}
+
+		compressed, err := compressor.NewWriter(hashOut)
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, compressed)
+
+		writers = append(writers, compressed)
+		counters = append(counters, counter)
+		hasherLists = append(hasherLists, hashers)
+		relpaths = append(relpaths, path.Join(relBase, filename))
+	}
+
+	err := encode(io.MultiWriter(writers...))
+	for i := len(closers) - 1; i >= 0; i-- {
+		if cerr := closers[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fileEntry, len(relpaths))
+	for i, relpath := range relpaths {
+		entries[i] = hashersToEntry(relpath, counters[i].n, hasherLists[i])
+	}
+	return entries, nil
+}
+
+func hashersToEntry(relpath string, size int64, hashers []*hashio.Hasher) fileEntry {
+	entry := fileEntry{relpath: relpath, size: size}
+	for _, hasher := range hashers {
+		digest := fmt.Sprintf("%x", hasher.Sum(nil))
+		switch hasher.Name() {
+		case "sha256":
+			entry.sha256 = digest
+		case "sha512":
+			entry.sha512 = digest
+		}
+	}
+	return entry
+}
+
+// buildRelease assembles the Release Paragraph for suiteName out of the
+// Suite's metadata and the fileEntry values collected while writing every
+// index.
+func (p Publisher) buildRelease(suiteName string, entries []fileEntry) Release {
+	suite := p.Suite
+	release := Release{
+		Origin:      suite.Origin,
+		Label:       suite.Label,
+		Suite:       suiteName,
+		Codename:    suite.Codename,
+		Version:     suite.Version,
+		Description: suite.Description,
+		Date:        p.Date.UTC().Format(time.RFC1123),
+		Components:  suite.Components(),
+	}
+
+	arches := map[string]bool{}
+	for _, component := range suite.Components() {
+		for _, arch := range suite.Binaries[component].Arches() {
+			arches[arch.String()] = true
+		}
+	}
+	for archName := range arches {
+		arch, err := dependency.ParseArch(archName)
+		if err != nil {
+			continue
+		}
+		release.Architectures = append(release.Architectures, *arch)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].relpath < entries[j].relpath })
+	for _, entry := range entries {
+		release.SHA256 = append(release.SHA256, control.SHA256FileHash{
+			FileHash: control.FileHash{
+				Filename: entry.relpath,
+				Size:     entry.size,
+				Hash:     entry.sha256,
+			},
+		})
+		release.SHA512 = append(release.SHA512, control.SHA512FileHash{
+			FileHash: control.FileHash{
+				Filename: entry.relpath,
+				Size:     entry.size,
+				Hash:     entry.sha512,
+			},
+		})
+	}
+	return release
+}
+
+// WriteTo writes dists/$suiteName/$COMPONENT/binary-$ARCH/Packages and
+// dists/$suiteName/$COMPONENT/source/Sources under root, one variant per
+// Compressor in suite.features.Compressors (by default {,.gz,.xz}), followed
+// by a Release covering all of them. If p.Signer is set, it also writes a
+// detached Release.gpg and a clearsigned InRelease.
+func (p Publisher) WriteTo(root, suiteName string) error {
+	base := path.Join(root, "dists", suiteName)
+	entries := []fileEntry{}
+
+	for component, binaries := range p.Suite.Binaries {
+		for _, arch := range binaries.Arches() {
+			relBase := path.Join(component, "binary-"+arch.String())
+			dir := path.Join(base, relBase)
+			written, err := p.writeIndex(dir, relBase, "Packages", func(w io.Writer) error {
+				return binaries.WriteArchTo(arch, w)
+			})
+			if err != nil {
+				return err
+			}
+			entries = append(entries, written...)
+		}
+	}
+
+	for component, sources := range p.Suite.Sources {
+		relBase := path.Join(component, "source")
+		dir := path.Join(base, relBase)
+		written, err := p.writeIndex(dir, relBase, "Sources", func(w io.Writer) error {
+			encoder, err := control.NewEncoder(w)
+			if err != nil {
+				return err
+			}
+			for _, src := range sources {
+				if err := encoder.Encode(src); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		entries = append(entries, written...)
+	}
+
+	release := p.buildRelease(suiteName, entries)
+
+	releaseFd, err := os.Create(path.Join(base, "Release"))
+	if err != nil {
+		return err
+	}
+	if err := release.Encode(releaseFd); err != nil {
+		releaseFd.Close()
+		return err
+	}
+	if err := releaseFd.Close(); err != nil {
+		return err
+	}
+
+	if p.Signer == nil {
+		return nil
+	}
+
+	raw, err := os.ReadFile(path.Join(base, "Release"))
+	if err != nil {
+		return err
+	}
+
+	gpgFd, err := os.Create(path.Join(base, "Release.gpg"))
+	if err != nil {
+		return err
+	}
+	if err := openpgp.ArmoredDetachSign(gpgFd, p.Signer, bytes.NewReader(raw), nil); err != nil {
+		gpgFd.Close()
+		return err
+	}
+	if err := gpgFd.Close(); err != nil {
+		return err
+	}
+
+	inReleaseFd, err := os.Create(path.Join(base, "InRelease"))
+	if err != nil {
+		return err
+	}
+	clearsignWriter, err := clearsign.Encode(inReleaseFd, p.Signer.PrivateKey, nil)
+	if err != nil {
+		inReleaseFd.Close()
+		return err
+	}
+	if _, err := clearsignWriter.Write(raw); err != nil {
+		clearsignWriter.Close()
+		inReleaseFd.Close()
+		return err
+	}
+	if err := clearsignWriter.Close(); err != nil {
+		inReleaseFd.Close()
+		return err
+	}
+	return inReleaseFd.Close()
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,74 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pault.ag/go/debian/control"
+)
+
+func TestPublisherWriteTo(t *testing.T) {
+	suite := NewSuite()
+	suite.Origin = "Test"
+	suite.AddPackageTo("main", testPackage(t, "testpkg", "1.0", "amd64", nil))
+	suite.AddSourceTo("main", testSource(t, "testsrc", "1.0", ""))
+
+	publisher := NewPublisher(&suite, nil)
+	publisher.Date = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	root := t.TempDir()
+	if err := publisher.WriteTo(root, "stable"); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	packagesPath := filepath.Join(root, "dists", "stable", "main", "binary-amd64", "Packages")
+	raw, err := os.ReadFile(packagesPath)
+	if err != nil {
+		t.Fatalf("ReadFile(Packages): %v", err)
+	}
+	if !strings.Contains(string(raw), "Package: testpkg\n") {
+		t.Errorf("Packages = %q, want a stanza for testpkg", raw)
+	}
+	for _, ext := range []string{".gz", ".xz"} {
+		if _, err := os.Stat(packagesPath + ext); err != nil {
+			t.Errorf("Stat(Packages%s): %v", ext, err)
+		}
+	}
+
+	sourcesPath := filepath.Join(root, "dists", "stable", "main", "source", "Sources")
+	raw, err = os.ReadFile(sourcesPath)
+	if err != nil {
+		t.Fatalf("ReadFile(Sources): %v", err)
+	}
+	if !strings.Contains(string(raw), "Package: testsrc\n") {
+		t.Errorf("Sources = %q, want a stanza for testsrc", raw)
+	}
+
+	releasePath := filepath.Join(root, "dists", "stable", "Release")
+	fd, err := os.Open(releasePath)
+	if err != nil {
+		t.Fatalf("Open(Release): %v", err)
+	}
+	defer fd.Close()
+
+	release := Release{}
+	if err := control.Unmarshal(&release, fd); err != nil {
+		t.Fatalf("Unmarshal(Release): %v", err)
+	}
+	if release.Origin != "Test" {
+		t.Errorf("Release.Origin = %q, want %q", release.Origin, "Test")
+	}
+	if want := "Mon, 01 Jan 2024 00:00:00 UTC"; release.Date != want {
+		t.Errorf("Release.Date = %q, want %q", release.Date, want)
+	}
+	if len(release.SHA256) == 0 {
+		t.Error("Release.SHA256 is empty, want one entry per generated index")
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "dists", "stable", "Release.gpg")); err == nil {
+		t.Error("Release.gpg was written for an unsigned Publisher")
+	}
+}
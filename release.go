@@ -0,0 +1,47 @@
+package archive
+
+import (
+	"io"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+// Release {{{
+
+// Release is the Paragraph written to dists/$SUITE/Release. It lists every
+// file a Publisher generated for a Suite, alongside the hashes declared in
+// suite.features.Hashes, so that apt can verify the whole tree after
+// fetching and verifying this file's OpenPGP signature.
+type Release struct {
+	control.Paragraph
+
+	Origin        string
+	Label         string
+	Suite         string
+	Codename      string
+	Version       string
+	Description   string
+	Date          string
+	Architectures []dependency.Arch `control:"Architectures"`
+	Components    []string
+
+	MD5Sum []control.MD5FileHash    `control:"MD5Sum" delim:"\n" strip:" \t\n\r" multiline:"true"`
+	SHA256 []control.SHA256FileHash `control:"SHA256" delim:"\n" strip:" \t\n\r" multiline:"true"`
+	SHA512 []control.SHA512FileHash `control:"SHA512" delim:"\n" strip:" \t\n\r" multiline:"true"`
+}
+
+// Encode writes the Release control Paragraph to out. Callers that need a
+// signed Release should prefer Publisher.WriteTo, which also produces
+// Release.gpg and InRelease.
+func (r Release) Encode(out io.Writer) error {
+	encoder, err := control.NewEncoder(out)
+	if err != nil {
+		return err
+	}
+	return encoder.Encode(r)
+}
+
+// }}}
+
+// vim: foldmethod=marker
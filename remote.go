@@ -0,0 +1,103 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// remoteFetcher {{{
+
+// remoteFetcher is the Fetcher used by NewRemoteArchive: it speaks
+// HTTP(S) to baseURL, and caches every file it fetches under cacheDir so
+// that repeat lookups can be satisfied with a conditional GET.
+type remoteFetcher struct {
+	baseURL  string
+	cacheDir string
+	client   *http.Client
+}
+
+// WithHTTPClient overrides the http.Client used by a remote Archive to
+// fetch files. Only has an effect on Archives created by NewRemoteArchive.
+// Without this option, a remote Archive uses http.DefaultClient.
+func WithHTTPClient(client *http.Client) ArchiveOption {
+	return func(a *Archive) {
+		if rf, ok := a.fetcher.(*remoteFetcher); ok {
+			rf.client = client
+		}
+	}
+}
+
+func (f *remoteFetcher) Open(relpath string) (io.ReadCloser, error) {
+	cachePath := path.Join(f.cacheDir, relpath)
+	etagPath := cachePath + ".etag"
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(f.baseURL, "/")+"/"+relpath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(cachePath); err == nil {
+		req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+		if etag, err := os.ReadFile(etagPath); err == nil {
+			req.Header.Set("If-None-Match", strings.TrimSpace(string(etag)))
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return os.Open(cachePath)
+	case http.StatusOK:
+		if err := os.MkdirAll(path.Dir(cachePath), 0755); err != nil {
+			return nil, err
+		}
+		tmp, err := os.CreateTemp(path.Dir(cachePath), ".tmp-*")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(tmp, resp.Body); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return nil, err
+		}
+		if err := tmp.Close(); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(tmp.Name(), cachePath); err != nil {
+			return nil, err
+		}
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			os.WriteFile(etagPath, []byte(etag), 0644)
+		}
+		return os.Open(cachePath)
+	default:
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", req.URL, resp.Status)
+	}
+}
+
+// }}}
+
+// NewRemoteArchive {{{
+
+// NewRemoteArchive creates an Archive that reads a repository over
+// HTTP(S), caching every file it fetches under cacheDir. Callers should
+// pass WithKeyring so that Suite can verify each InRelease's OpenPGP
+// signature before trusting anything it lists.
+func NewRemoteArchive(baseURL, cacheDir string, opts ...ArchiveOption) Archive {
+	a := Archive{fetcher: &remoteFetcher{baseURL: baseURL, cacheDir: cacheDir, client: http.DefaultClient}}
+	for _, opt := range opts {
+		opt(&a)
+	}
+	return a
+}
+
+// }}}
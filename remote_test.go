@@ -0,0 +1,55 @@
+package archive
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRemoteFetcherCachesAndRevalidates(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-Modified-Since") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("Release contents"))
+	}))
+	defer server.Close()
+
+	archive := NewRemoteArchive(server.URL, t.TempDir())
+	fetcher := archive.fetcher.(*remoteFetcher)
+
+	fd, err := fetcher.Open("dists/stable/Release")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	got, err := io.ReadAll(fd)
+	fd.Close()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != "Release contents" {
+		t.Fatalf("Open returned %q, want %q", got, "Release contents")
+	}
+
+	// A second Open should revalidate against the cached copy via
+	// If-Modified-Since rather than re-downloading the body.
+	fd2, err := fetcher.Open("dists/stable/Release")
+	if err != nil {
+		t.Fatalf("second Open: %v", err)
+	}
+	got2, err := io.ReadAll(fd2)
+	fd2.Close()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got2) != "Release contents" {
+		t.Fatalf("second Open returned %q, want %q", got2, "Release contents")
+	}
+	if requests != 2 {
+		t.Fatalf("server saw %d requests, want 2", requests)
+	}
+}
@@ -0,0 +1,321 @@
+package archive
+
+import (
+	"fmt"
+	"strings"
+
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Resolver {{{
+
+// Resolver resolves package names and dependency.Dependency values to
+// Package values across one or more Suites. Suites are layered by
+// priority, apt-pinning style: when a name is available from more than
+// one, the Suite listed first in Suites wins.
+type Resolver struct {
+	Suites []*Suite
+}
+
+// NewResolver creates a Resolver over suites, highest priority first.
+func NewResolver(suites ...*Suite) *Resolver {
+	return &Resolver{Suites: suites}
+}
+
+// DependencyError reports a dependency.Relation that no Package in the
+// Resolver's Suites could satisfy.
+type DependencyError struct {
+	Package  string
+	Relation dependency.Relation
+	Reason   string
+}
+
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", e.Package, e.Relation, e.Reason)
+}
+
+// index {{{
+
+// index builds a map from every name a Package in the Resolver's Suites is
+// known by -- its own Package field, plus anything it Provides -- to the
+// Package values behind that name, in Suite priority order.
+func (r *Resolver) index(arch dependency.Arch) map[string][]Package {
+	index := map[string][]Package{}
+	seen := map[string]bool{}
+
+	add := func(name string, pkg Package) {
+		key := name + ":" + pkg.Package
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		index[name] = append(index[name], pkg)
+	}
+
+	for _, suite := range r.Suites {
+		for _, component := range suite.Components() {
+			for _, pkg := range suite.Binaries[component].Get(arch) {
+				add(pkg.Package, pkg)
+				for _, provided := range possibilitiesOf(pkg.Paragraph.Values["Provides"]) {
+					add(provided.Name, pkg)
+				}
+			}
+		}
+	}
+	return index
+}
+
+// }}}
+
+// possibilitiesOf {{{
+
+// possibilitiesOf parses a Depends-style control field into the flat list
+// of Possibility values it offers; a malformed or empty field yields nil.
+func possibilitiesOf(raw string) []dependency.Possibility {
+	if raw == "" {
+		return nil
+	}
+	dep, err := dependency.Parse(raw)
+	if err != nil || dep == nil {
+		return nil
+	}
+	possibilities := []dependency.Possibility{}
+	for _, relation := range dep.Relations {
+		possibilities = append(possibilities, relation.Possibilities...)
+	}
+	return possibilities
+}
+
+// }}}
+
+// satisfies {{{
+
+// satisfies reports whether pkg is an acceptable match for poss: the name
+// already having been used to look pkg up in the index, this only needs to
+// check the (optional) version constraint and architecture qualifier.
+func satisfies(pkg Package, poss dependency.Possibility) bool {
+	if poss.Arch != nil {
+		qualifier := poss.Arch.String()
+		if qualifier != "any" && qualifier != pkg.Architecture.String() {
+			return false
+		}
+	}
+
+	if poss.Version == nil {
+		return true
+	}
+
+	want, err := version.Parse(poss.Version.Number)
+	if err != nil {
+		return false
+	}
+
+	cmp := version.Compare(pkg.Version, want)
+	switch poss.Version.Operator {
+	case "<<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case "=":
+		return cmp == 0
+	case ">=":
+		return cmp >= 0
+	case ">>":
+		return cmp > 0
+	default:
+		return true
+	}
+}
+
+// }}}
+
+// choose {{{
+
+// choose picks, among rel's Possibilities, a satisfiable Package: one
+// already resolved wins outright, otherwise the highest-Priority,
+// highest-Version candidate from the first Possibility with any match.
+func choose(rel dependency.Relation, index map[string][]Package, resolved map[string]Package) (Package, bool) {
+	for _, poss := range rel.Possibilities {
+		if pkg, ok := resolved[poss.Name]; ok && satisfies(pkg, poss) {
+			return pkg, true
+		}
+	}
+
+	for _, poss := range rel.Possibilities {
+		var best Package
+		found := false
+		for _, pkg := range index[poss.Name] {
+			if !satisfies(pkg, poss) {
+				continue
+			}
+			if !found || betterCandidate(pkg, best) {
+				best, found = pkg, true
+			}
+		}
+		if found {
+			return best, true
+		}
+	}
+
+	return Package{}, false
+}
+
+// betterCandidate breaks ties between two Packages satisfying the same
+// Possibility by Priority, then by Version.
+func betterCandidate(a, b Package) bool {
+	if a.Priority != b.Priority {
+		return priorityRank(a.Priority) > priorityRank(b.Priority)
+	}
+	return version.Compare(a.Version, b.Version) > 0
+}
+
+func priorityRank(priority string) int {
+	switch priority {
+	case "required":
+		return 5
+	case "important":
+		return 4
+	case "standard":
+		return 3
+	case "optional":
+		return 2
+	case "extra":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// }}}
+
+// Resolve {{{
+
+// Resolve returns the transitive closure of Package values satisfying dep
+// for arch, resolving Provides, versioned relationships and "pkg:any"
+// architecture qualifiers along the way. Each Relation is satisfied by a
+// Possibility whose Package is already resolved if there is one, otherwise
+// by the first satisfiable Possibility; an unsatisfiable Relation is reported as a
+// *DependencyError naming the Package whose Depends line could not be
+// honored.
+func (r *Resolver) Resolve(dep *dependency.Dependency, arch dependency.Arch) ([]Package, error) {
+	type pending struct {
+		owner    string
+		relation dependency.Relation
+	}
+
+	index := r.index(arch)
+	resolved := map[string]Package{}
+	order := []Package{}
+
+	queue := []pending{}
+	for _, rel := range dep.Relations {
+		queue = append(queue, pending{owner: "(root)", relation: rel})
+	}
+
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+
+		pkg, ok := choose(next.relation, index, resolved)
+		if !ok {
+			return nil, &DependencyError{Package: next.owner, Relation: next.relation, Reason: "no satisfiable alternative"}
+		}
+		if _, ok := resolved[pkg.Package]; ok {
+			continue
+		}
+		resolved[pkg.Package] = pkg
+		order = append(order, pkg)
+
+		deps, err := dependency.Parse(pkg.Paragraph.Values["Depends"])
+		if err == nil && deps != nil {
+			for _, childRel := range deps.Relations {
+				queue = append(queue, pending{owner: pkg.Package, relation: childRel})
+			}
+		}
+	}
+
+	return order, nil
+}
+
+// ResolveNames is a convenience wrapper around Resolve for callers that
+// only have a starting set of bare package names, rather than an already
+// parsed *dependency.Dependency.
+func (r *Resolver) ResolveNames(names []string, arch dependency.Arch) ([]Package, error) {
+	relations := make([]dependency.Relation, len(names))
+	for i, name := range names {
+		relations[i] = dependency.Relation{
+			Possibilities: []dependency.Possibility{{Name: name}},
+		}
+	}
+	return r.Resolve(&dependency.Dependency{Relations: relations}, arch)
+}
+
+// }}}
+
+// BuildOrder {{{
+
+// BuildOrder topologically sorts sources by their Build-Depends closure,
+// restricted to sources also present in the list, so that rebuilding them
+// in the returned order never builds a source before something it depends
+// on. A cycle in Build-Depends is reported as an error naming the cycle.
+func (r *Resolver) BuildOrder(sources []Source) ([]Source, error) {
+	byName := map[string]Source{}
+	for _, src := range sources {
+		byName[src.Package] = src
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	order := []Source{}
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("Build-Depends cycle: %s -> %s", strings.Join(path, " -> "), name)
+		}
+
+		src, ok := byName[name]
+		if !ok {
+			return nil
+		}
+
+		state[name] = visiting
+		deps, err := src.BuildDepends()
+		if err == nil && deps != nil {
+			for _, rel := range deps.Relations {
+				for _, poss := range rel.Possibilities {
+					if _, ok := byName[poss.Name]; !ok {
+						continue
+					}
+					if err := visit(poss.Name, append(path, name)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		state[name] = visited
+		order = append(order, src)
+		return nil
+	}
+
+	for _, src := range sources {
+		if err := visit(src.Package, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// }}}
+
+// }}}
+
+// vim: foldmethod=marker
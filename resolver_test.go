@@ -0,0 +1,176 @@
+package archive
+
+import (
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+func mustArch(t *testing.T, name string) dependency.Arch {
+	t.Helper()
+	arch, err := dependency.ParseArch(name)
+	if err != nil {
+		t.Fatalf("ParseArch(%q): %v", name, err)
+	}
+	return *arch
+}
+
+func mustVersion(t *testing.T, raw string) version.Version {
+	t.Helper()
+	v, err := version.Parse(raw)
+	if err != nil {
+		t.Fatalf("version.Parse(%q): %v", raw, err)
+	}
+	return v
+}
+
+// testPackage builds a Package fixture with an already-initialized
+// Paragraph, so fields resolver.go reads straight off Paragraph.Values
+// (Depends, Provides) can be set with control.Paragraph.Set.
+func testPackage(t *testing.T, name, ver, arch string, fields map[string]string) Package {
+	t.Helper()
+	pkg := Package{
+		Package:      name,
+		Version:      mustVersion(t, ver),
+		Architecture: mustArch(t, arch),
+		Priority:     "optional",
+	}
+	pkg.Paragraph = control.Paragraph{Values: map[string]string{}}
+	for key, value := range fields {
+		pkg.Paragraph.Set(key, value)
+	}
+	return pkg
+}
+
+func testSource(t *testing.T, name, ver, buildDepends string) Source {
+	t.Helper()
+	src := Source{
+		Package: name,
+		Version: mustVersion(t, ver),
+	}
+	src.Paragraph = control.Paragraph{Values: map[string]string{}}
+	if buildDepends != "" {
+		src.Paragraph.Set("Build-Depends", buildDepends)
+	}
+	return src
+}
+
+func TestResolverResolveTransitive(t *testing.T) {
+	arch := mustArch(t, "amd64")
+	suite := NewSuite()
+	suite.AddPackageTo("main", testPackage(t, "a", "1.0", "amd64", map[string]string{
+		"Depends": "b",
+	}))
+	suite.AddPackageTo("main", testPackage(t, "b", "1.0", "amd64", nil))
+
+	resolver := NewResolver(&suite)
+	resolved, err := resolver.ResolveNames([]string{"a"}, arch)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	var names []string
+	for _, pkg := range resolved {
+		names = append(names, pkg.Package)
+	}
+	if got := strings.Join(names, ","); got != "a,b" {
+		t.Fatalf("Resolve order = %q, want %q", got, "a,b")
+	}
+}
+
+func TestResolverResolveProvides(t *testing.T) {
+	arch := mustArch(t, "amd64")
+	suite := NewSuite()
+	suite.AddPackageTo("main", testPackage(t, "mailx", "1.0", "amd64", map[string]string{
+		"Depends": "mail-transport-agent",
+	}))
+	suite.AddPackageTo("main", testPackage(t, "exim4", "4.96", "amd64", map[string]string{
+		"Provides": "mail-transport-agent",
+	}))
+
+	resolver := NewResolver(&suite)
+	resolved, err := resolver.ResolveNames([]string{"mailx"}, arch)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if len(resolved) != 2 || resolved[1].Package != "exim4" {
+		t.Fatalf("Resolve = %+v, want [mailx exim4]", resolved)
+	}
+}
+
+func TestResolverResolveVersionConstraint(t *testing.T) {
+	arch := mustArch(t, "amd64")
+	suite := NewSuite()
+	suite.AddPackageTo("main", testPackage(t, "app", "1.0", "amd64", map[string]string{
+		"Depends": "libfoo (>= 2.0)",
+	}))
+	suite.AddPackageTo("main", testPackage(t, "libfoo", "1.0", "amd64", nil))
+
+	resolver := NewResolver(&suite)
+	_, err := resolver.ResolveNames([]string{"app"}, arch)
+	if err == nil {
+		t.Fatal("Resolve succeeded, want unsatisfiable libfoo (>= 2.0)")
+	}
+	depErr, ok := err.(*DependencyError)
+	if !ok {
+		t.Fatalf("error = %T, want *DependencyError", err)
+	}
+	if depErr.Package != "app" {
+		t.Fatalf("DependencyError.Package = %q, want %q", depErr.Package, "app")
+	}
+}
+
+func TestResolverResolveUnsatisfiable(t *testing.T) {
+	arch := mustArch(t, "amd64")
+	suite := NewSuite()
+
+	resolver := NewResolver(&suite)
+	_, err := resolver.ResolveNames([]string{"nonexistent"}, arch)
+	if err == nil {
+		t.Fatal("Resolve succeeded, want error for missing package")
+	}
+	if _, ok := err.(*DependencyError); !ok {
+		t.Fatalf("error = %T, want *DependencyError", err)
+	}
+}
+
+func TestResolverBuildOrder(t *testing.T) {
+	sources := []Source{
+		testSource(t, "app", "1.0", "libfoo"),
+		testSource(t, "libfoo", "1.0", "libbar"),
+		testSource(t, "libbar", "1.0", ""),
+	}
+
+	resolver := NewResolver()
+	order, err := resolver.BuildOrder(sources)
+	if err != nil {
+		t.Fatalf("BuildOrder: %v", err)
+	}
+
+	position := map[string]int{}
+	for i, src := range order {
+		position[src.Package] = i
+	}
+	if position["libbar"] > position["libfoo"] || position["libfoo"] > position["app"] {
+		t.Fatalf("BuildOrder = %+v, want libbar before libfoo before app", order)
+	}
+}
+
+func TestResolverBuildOrderCycle(t *testing.T) {
+	sources := []Source{
+		testSource(t, "a", "1.0", "b"),
+		testSource(t, "b", "1.0", "a"),
+	}
+
+	resolver := NewResolver()
+	_, err := resolver.BuildOrder(sources)
+	if err == nil {
+		t.Fatal("BuildOrder succeeded, want cycle error")
+	}
+	if !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("error = %q, want it to mention a cycle", err.Error())
+	}
+}
@@ -119,8 +119,8 @@ func SourceFromDsc(dsc *control.DSC, directory string) (*Source, error) {
 	pkg := Source{}
 
 	paragraph := dsc.Paragraph
+	paragraph.Set("Package", dsc.Source)
 	paragraph.Set("Directory", directory)
-	// paragraph.Set("Filename", debFile.Path)
 
 	return &pkg, control.UnpackFromParagraph(paragraph, &pkg)
 }